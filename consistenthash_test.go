@@ -0,0 +1,69 @@
+package goloadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHashRingGetIsStableForSameKey(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	u3, _ := url.Parse("http://backend3")
+	backends := []*Backend{
+		{URL: u1, Alive: true},
+		{URL: u2, Alive: true},
+		{URL: u3, Alive: true},
+	}
+	ring := newHashRing(backends, 160)
+
+	first := ring.get("session-42")
+	for i := 0; i < 10; i++ {
+		if got := ring.get("session-42"); got != first {
+			t.Fatalf("expected the same key to always land on the same backend, got %v want %v", got.ID(), first.ID())
+		}
+	}
+}
+
+func TestHashRingGetSkipsDeadBackends(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	dead := &Backend{URL: u1, Alive: false}
+	alive := &Backend{URL: u2, Alive: true}
+	ring := newHashRing([]*Backend{dead, alive}, 160)
+
+	for i := 0; i < 50; i++ {
+		key := string(rune('a' + i))
+		if got := ring.get(key); got != alive {
+			t.Fatalf("expected only the alive backend to be picked, got %v", got.ID())
+		}
+	}
+}
+
+func TestConsistentHashPickUsesKeyFunc(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: true}
+	b2 := &Backend{URL: u2, Alive: true}
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+
+	keyFunc := func(r *http.Request) string { return r.Header.Get("X-Cache-Key") }
+	strategy := NewConsistentHash(pool, 0, keyFunc)
+
+	// Different paths, same cache key: only the custom KeyFunc makes the
+	// two requests hash to the same place.
+	req1 := httptest.NewRequest("GET", "/a", nil)
+	req1.Header.Set("X-Cache-Key", "item-1")
+	req2 := httptest.NewRequest("GET", "/b", nil)
+	req2.Header.Set("X-Cache-Key", "item-1")
+
+	first := strategy.Pick(req1)
+	second := strategy.Pick(req2)
+	if first == nil || second == nil {
+		t.Fatal("expected a backend to be picked")
+	}
+	if first.ID() != second.ID() {
+		t.Fatalf("expected requests with the same cache key to land on the same backend, got %v and %v", first.ID(), second.ID())
+	}
+}
@@ -0,0 +1,194 @@
+package goloadbalancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HealthCheckMode selects how a HealthChecker probes a backend.
+type HealthCheckMode string
+
+const (
+	// HealthCheckTCP dials the backend and considers it healthy if the
+	// connection succeeds. This is the default mode.
+	HealthCheckTCP HealthCheckMode = "tcp"
+	// HealthCheckHTTP issues an HTTP request and considers the backend
+	// healthy on a 2xx response.
+	HealthCheckHTTP HealthCheckMode = "http"
+	// HealthCheckGRPC calls the grpc-health-v1 Check RPC via
+	// HealthChecker.GRPCHealthCheck and considers the backend healthy
+	// when it reports SERVING.
+	HealthCheckGRPC HealthCheckMode = "grpc"
+)
+
+// BackendServerUpGauge is invoked after every active health check with
+// the backend's URL and 1 (up) or 0 (down), so callers can wire it to a
+// Prometheus gauge, e.g.:
+//
+//	goloadbalancer.BackendServerUpGauge = func(url string, up float64) {
+//	    upGauge.WithLabelValues(url).Set(up)
+//	}
+//
+// It defaults to a no-op.
+var BackendServerUpGauge = func(backendURL string, up float64) {}
+
+func reportBackendUp(u *url.URL, alive bool) {
+	up := 0.0
+	if alive {
+		up = 1.0
+	}
+	BackendServerUpGauge(u.String(), up)
+	if alive {
+		log.Println(u, "is alive")
+	} else {
+		log.Println(u, "is dead")
+	}
+}
+
+// GRPCHealthCheckFunc dials addr and reports whether the grpc-health-v1
+// Check RPC returned SERVING.
+type GRPCHealthCheckFunc func(ctx context.Context, addr string) (bool, error)
+
+// HealthChecker actively probes a backend on an interval, in the style
+// of Traefik's health check configuration. The zero value is a TCP
+// check against the backend's own host:port every 2 seconds.
+type HealthChecker struct {
+	// Mode selects the probe: HealthCheckTCP (default), HealthCheckHTTP,
+	// or HealthCheckGRPC.
+	Mode HealthCheckMode
+	// Scheme is the URL scheme used for HTTP probes (default "http").
+	Scheme string
+	// Path is the HTTP path probed, e.g. "/healthz" (default "/").
+	Path string
+	// Method is the HTTP method used for HTTP probes (default "GET").
+	Method string
+	// Port overrides the backend's port for the probe, if non-zero.
+	Port int
+	// Hostname overrides the backend's host for the probe and is sent
+	// as the Host header for HTTP probes.
+	Hostname string
+	// Headers are extra headers sent with HTTP probes.
+	Headers http.Header
+	// Interval is how often the backend is probed (default 2s).
+	Interval time.Duration
+	// Timeout bounds a single probe (default 2s).
+	Timeout time.Duration
+	// GRPCHealthCheck performs the probe when Mode is HealthCheckGRPC.
+	// It is required in that mode; there is no built-in default since
+	// wiring a real grpc-health-v1 client pulls in the grpc module.
+	GRPCHealthCheck GRPCHealthCheckFunc
+
+	client *http.Client
+}
+
+// init fills in defaults for zero-valued fields. It is idempotent.
+func (h *HealthChecker) init() {
+	if h.Mode == "" {
+		h.Mode = HealthCheckTCP
+	}
+	if h.Scheme == "" {
+		h.Scheme = "http"
+	}
+	if h.Method == "" {
+		h.Method = http.MethodGet
+	}
+	if h.Path == "" {
+		h.Path = "/"
+	}
+	if h.Interval <= 0 {
+		h.Interval = 2 * time.Second
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = 2 * time.Second
+	}
+	if h.client == nil {
+		h.client = &http.Client{Timeout: h.Timeout}
+	}
+}
+
+// addr returns the host:port this checker dials or requests, honoring
+// the Port and Hostname overrides. When neither the URL nor Port names a
+// port, it returns the bare host.
+func (h *HealthChecker) addr(u *url.URL) string {
+	host := u.Hostname()
+	if h.Hostname != "" {
+		host = h.Hostname
+	}
+	port := u.Port()
+	if h.Port != 0 {
+		port = strconv.Itoa(h.Port)
+	}
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Probe performs a single health check against u and reports whether it
+// succeeded.
+func (h *HealthChecker) Probe(ctx context.Context, u *url.URL) bool {
+	h.init()
+	addr := h.addr(u)
+	switch h.Mode {
+	case HealthCheckHTTP:
+		return h.probeHTTP(ctx, addr)
+	case HealthCheckGRPC:
+		return h.probeGRPC(ctx, addr)
+	default:
+		return h.probeTCP(ctx, addr)
+	}
+}
+
+func (h *HealthChecker) probeTCP(ctx context.Context, addr string) bool {
+	d := net.Dialer{Timeout: h.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		log.Println("health check:", addr, "unreachable:", err)
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+func (h *HealthChecker) probeHTTP(ctx context.Context, addr string) bool {
+	reqURL := fmt.Sprintf("%s://%s%s", h.Scheme, addr, h.Path)
+	req, err := http.NewRequestWithContext(ctx, h.Method, reqURL, nil)
+	if err != nil {
+		log.Println("health check: bad request for", addr, ":", err)
+		return false
+	}
+	for k, vs := range h.Headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if h.Hostname != "" {
+		req.Host = h.Hostname
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		log.Println("health check:", addr, "unreachable:", err)
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func (h *HealthChecker) probeGRPC(ctx context.Context, addr string) bool {
+	if h.GRPCHealthCheck == nil {
+		log.Println("health check:", addr, "mode is grpc but GRPCHealthCheck is unset")
+		return false
+	}
+	up, err := h.GRPCHealthCheck(ctx, addr)
+	if err != nil {
+		log.Println("health check:", addr, "grpc check failed:", err)
+		return false
+	}
+	return up
+}
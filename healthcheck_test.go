@@ -0,0 +1,72 @@
+package goloadbalancer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerProbeHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := &HealthChecker{Mode: HealthCheckHTTP, Path: "/healthz", Timeout: time.Second}
+	if !up.Probe(context.Background(), u) {
+		t.Fatal("expected a 2xx response to report the backend as up")
+	}
+
+	down := &HealthChecker{Mode: HealthCheckHTTP, Path: "/down", Timeout: time.Second}
+	if down.Probe(context.Background(), u) {
+		t.Fatal("expected a non-2xx response to report the backend as down")
+	}
+}
+
+func TestHealthCheckerProbeTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	reachable, _ := url.Parse("tcp://" + ln.Addr().String())
+	hc := &HealthChecker{Timeout: time.Second}
+	if !hc.Probe(context.Background(), reachable) {
+		t.Fatal("expected a listening port to report the backend as up")
+	}
+
+	closedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closedLn.Addr().String()
+	closedLn.Close()
+
+	unreachable, _ := url.Parse("tcp://" + closedAddr)
+	if hc.Probe(context.Background(), unreachable) {
+		t.Fatal("expected a closed port to report the backend as down")
+	}
+}
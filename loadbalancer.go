@@ -1,8 +1,7 @@
 package goloadbalancer
 
 import (
-	"log"
-	"net"
+	"context"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -26,37 +25,235 @@ type Backend struct {
 	// the reverse proxy that handles requests
 	// to this backend
 	Proxy *httputil.ReverseProxy
+
+	// HealthCheck configures how this backend is actively probed. A nil
+	// HealthCheck falls back to a TCP dial every 2 seconds.
+	HealthCheck *HealthChecker
+
+	// Weight is this backend's nominal weight, used by the
+	// WeightedRoundRobin strategy. A Weight <= 0 is treated as 1.
+	Weight int
+	// effectiveWeight and currentWeight implement Nginx's smooth
+	// weighted round-robin algorithm and are only touched by
+	// WeightedRoundRobin.
+	effectiveWeight int64
+	currentWeight   int64
+
+	// activeConnections is the number of in-flight requests currently
+	// being served by this backend, used by the LeastConnections
+	// strategy.
+	activeConnections int64
+
+	// ewmaMu protects ewma
+	ewmaMu sync.Mutex
+	// ewma is the exponentially weighted moving average of this
+	// backend's response latency in milliseconds, used by the
+	// PowerOfTwoChoices strategy.
+	ewma float64
+
+	// pheMu protects the passive-health-check / circuit-breaker fields
+	// below.
+	pheMu sync.Mutex
+	// consecutiveFails counts passive failures (5xx or proxy errors)
+	// observed since the last success or reset window.
+	consecutiveFails int
+	// lastFailure is when consecutiveFails was last incremented.
+	lastFailure time.Time
+	// ejectedUntil is when this backend is re-admitted to rotation
+	// after being ejected by the circuit breaker.
+	ejectedUntil time.Time
+	// ejectionCount is how many times this backend has been ejected,
+	// used to grow the backoff exponentially. It is never reset.
+	ejectionCount int
 }
 
 // ServerPool holds information about reachable backends
 type ServerPool struct {
-	// backends slice
-	backends []*Backend
-	// current index of the slice
+	// backends holds the current backend set. It is swapped atomically
+	// by AddBackend/RemoveBackend/ReplaceBackends so reads on the hot
+	// path (NextPeer, strategies) never block on a writer.
+	backends atomic.Pointer[[]*Backend]
+	// backendsMu serializes AddBackend/RemoveBackend/ReplaceBackends so
+	// concurrent writers don't race each other's read-modify-write of
+	// backends; it is never held by a reader.
+	backendsMu sync.Mutex
+	// current index of the slice, used by the round-robin strategy
 	current uint64
+	// strategy picks the next backend for a request
+	strategy Strategy
+
+	// healthCtx is non-nil once StartHealthChecks has run, and is used by
+	// configureBackend to start a health-check goroutine for backends
+	// added afterward (AddBackend, ReplaceBackends, a Provider).
+	healthCtx context.Context
+	// healthCancel stops the goroutines started by StartHealthChecks.
+	healthCancel context.CancelFunc
+	// healthWG is released once every health-check goroutine has
+	// returned after healthCancel is called.
+	healthWG sync.WaitGroup
+	// healthCancels maps a backend ID to the CancelFunc for its active
+	// health-check goroutine, so RemoveBackend and AddBackend (which
+	// replaces a backend wholesale) can stop the superseded goroutine
+	// instead of leaking it.
+	healthCancels map[string]context.CancelFunc
+	// healthMu protects healthCancels.
+	healthMu sync.Mutex
+
+	// passive holds the circuit-breaker configuration set by
+	// EnablePassiveHealthCheck, or nil if passive health checking is
+	// disabled.
+	passive *PassiveHealthCheck
+
+	// persistence holds the session affinity configuration set by
+	// EnablePersistence, or nil if every request goes through strategy.
+	persistence *Persistence
+}
+
+// NewServerPool creates a ServerPool for the given backends. If strategy
+// is nil, the pool falls back to classic round-robin.
+func NewServerPool(backends []*Backend, strategy Strategy) *ServerPool {
+	s := &ServerPool{}
+	snapshot := append([]*Backend(nil), backends...)
+	s.backends.Store(&snapshot)
+	if strategy == nil {
+		strategy = NewRoundRobin(s)
+	}
+	s.strategy = strategy
+	return s
+}
+
+// SetStrategy replaces the pool's load-balancing strategy.
+func (s *ServerPool) SetStrategy(strategy Strategy) {
+	s.strategy = strategy
+}
+
+// Backends returns a snapshot of the pool's current backends. The
+// returned slice belongs to the caller; mutate membership with
+// AddBackend, RemoveBackend or ReplaceBackends instead of editing it.
+func (s *ServerPool) Backends() []*Backend {
+	p := s.backends.Load()
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// AddBackend adds b to the pool, or replaces the existing backend with
+// the same ID in place. Whichever pool-wide features are already enabled
+// (EnablePassiveHealthCheck, EnablePersistence, StartHealthChecks) are
+// wired onto b, so backends added after startup don't silently lose them.
+func (s *ServerPool) AddBackend(b *Backend) {
+	s.backendsMu.Lock()
+	defer s.backendsMu.Unlock()
+
+	current := s.Backends()
+	next := make([]*Backend, 0, len(current)+1)
+	replaced := false
+	for _, existing := range current {
+		if existing.ID() == b.ID() {
+			next = append(next, b)
+			replaced = true
+			continue
+		}
+		next = append(next, existing)
+	}
+	if !replaced {
+		next = append(next, b)
+	}
+	s.backends.Store(&next)
+	// b.ID() may have had a health-check goroutine running for the
+	// backend it replaces; stop that one before configureBackend
+	// potentially starts a new one for b.
+	s.stopBackendHealthCheck(b.ID())
+	s.configureBackend(b)
+}
+
+// RemoveBackend removes the backend with the given ID from the pool, if
+// present, and stops its active health-check goroutine.
+func (s *ServerPool) RemoveBackend(id string) {
+	s.backendsMu.Lock()
+	defer s.backendsMu.Unlock()
+
+	current := s.Backends()
+	next := make([]*Backend, 0, len(current))
+	for _, existing := range current {
+		if existing.ID() != id {
+			next = append(next, existing)
+		}
+	}
+	s.backends.Store(&next)
+	s.stopBackendHealthCheck(id)
 }
 
-// NextIndex atomically increase the counter and return an index
-func (s *ServerPool) NextIndex() int {
+// ReplaceBackends atomically swaps in an entirely new backend set, e.g.
+// after a full config reload. Like AddBackend, every backend in the new
+// set is configured with whichever pool-wide features are already
+// enabled, and any health-check goroutine belonging to a backend that
+// didn't make it into the new set is stopped.
+func (s *ServerPool) ReplaceBackends(backends []*Backend) {
+	s.backendsMu.Lock()
+	defer s.backendsMu.Unlock()
+
+	current := s.Backends()
+	next := append([]*Backend(nil), backends...)
+
+	inNext := make(map[string]bool, len(next))
+	for _, b := range next {
+		inNext[b.ID()] = true
+	}
+	for _, old := range current {
+		if !inNext[old.ID()] {
+			s.stopBackendHealthCheck(old.ID())
+		}
+	}
+
+	s.backends.Store(&next)
+	for _, b := range next {
+		s.stopBackendHealthCheck(b.ID())
+		s.configureBackend(b)
+	}
+}
+
+// configureBackend wires b into whichever pool-wide features are already
+// enabled on s, so it behaves the same as a backend that was present at
+// EnablePassiveHealthCheck/EnablePersistence/StartHealthChecks time.
+// Callers must hold backendsMu.
+func (s *ServerPool) configureBackend(b *Backend) {
+	if s.passive != nil {
+		s.wireErrorHandler(b)
+	}
+	if s.persistence != nil && s.persistence.Mode == PersistenceCookie {
+		s.wireStickyCookie(b)
+	}
+	if s.healthCtx != nil {
+		s.startBackendHealthCheck(b)
+	}
+}
+
+// NextIndex atomically increases the counter and returns an index into a
+// slice of the given length. n must be the length of the same backends
+// snapshot the caller is indexing into, not a fresh call to
+// s.Backends(): the pool can be mutated concurrently, and re-reading
+// would let the slice shrink (or go empty) between the caller's length
+// check and this divide. Callers must ensure n > 0.
+func (s *ServerPool) NextIndex(n int) int {
 	// Multiple clients can call this at once
-	return int(atomic.AddUint64(&s.current, uint64(1)) % uint64(len(s.backends)))
-}
-
-// NextPeer returns next active peer to take a connection
-func (s *ServerPool) NextPeer() *Backend {
-	next := s.NextIndex()
-	l := len(s.backends) + next // start from next and move a full cycle
-	for i := next; i < l; i++ {
-		index := i % len(s.backends)
-		if s.backends[index].IsAlive() {
-			// if we have an alive backend, use it and store it's index
-			if i != next {
-				atomic.StoreUint64(&s.current, uint64(index))
-			}
-			return s.backends[index]
+	return int(atomic.AddUint64(&s.current, uint64(1)) % uint64(n))
+}
+
+// NextPeer returns the next backend to take the request. When session
+// persistence is enabled and applies to r, it wins; otherwise the pool's
+// Strategy picks.
+func (s *ServerPool) NextPeer(r *http.Request) *Backend {
+	if s.persistence != nil {
+		if peer := s.persistence.pick(s, r); peer != nil {
+			return peer
 		}
 	}
-	return nil
+	if s.strategy == nil {
+		return nil
+	}
+	return s.strategy.Pick(r)
 }
 
 // SetAlive for this backend
@@ -66,41 +263,112 @@ func (b *Backend) SetAlive(alive bool) {
 	b.mu.Unlock()
 }
 
-// IsAlive returns true when backend is alive
+// ID returns a stable identifier for this backend, used to address it
+// from session persistence and backend-management APIs.
+func (b *Backend) ID() string {
+	return b.URL.String()
+}
+
+// IsAlive returns true when backend is alive and not currently ejected
+// by the passive health check circuit breaker.
 func (b *Backend) IsAlive() (alive bool) {
 	b.mu.RLock()
 	alive = b.Alive
 	b.mu.RUnlock()
-	return
+	if alive && b.IsEjected() {
+		return false
+	}
+	return alive
+}
+
+// IncConnections increments the in-flight request count for this backend.
+func (b *Backend) IncConnections() {
+	atomic.AddInt64(&b.activeConnections, 1)
+}
+
+// DecConnections decrements the in-flight request count for this backend.
+func (b *Backend) DecConnections() {
+	atomic.AddInt64(&b.activeConnections, -1)
+}
+
+// Connections returns the number of requests currently in flight to this
+// backend.
+func (b *Backend) Connections() int64 {
+	return atomic.LoadInt64(&b.activeConnections)
+}
+
+// ewmaAlpha is the smoothing factor used when updating a backend's
+// latency EWMA: ewma = alpha*sample + (1-alpha)*ewma.
+const ewmaAlpha = 0.2
+
+// RecordLatency folds a response latency sample into this backend's
+// EWMA, used by the PowerOfTwoChoices strategy.
+func (b *Backend) RecordLatency(d time.Duration) {
+	sample := float64(d.Milliseconds())
+	b.ewmaMu.Lock()
+	if b.ewma == 0 {
+		b.ewma = sample
+	} else {
+		b.ewma = ewmaAlpha*sample + (1-ewmaAlpha)*b.ewma
+	}
+	b.ewmaMu.Unlock()
+}
+
+// EWMA returns this backend's current latency EWMA, in milliseconds.
+func (b *Backend) EWMA() float64 {
+	b.ewmaMu.Lock()
+	defer b.ewmaMu.Unlock()
+	return b.ewma
+}
+
+// serve proxies r to peer, tracking in-flight connections and latency
+// EWMA, and, when passive health checking is enabled, feeding the
+// response status into the circuit breaker.
+func (s *ServerPool) serve(peer *Backend, w http.ResponseWriter, r *http.Request) {
+	peer.IncConnections()
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		peer.DecConnections()
+		peer.RecordLatency(time.Since(start))
+		if s.passive != nil {
+			if rec.status >= http.StatusInternalServerError {
+				peer.RecordFailure(s.passive)
+			} else {
+				peer.RecordSuccess()
+			}
+		}
+	}()
+	peer.Proxy.ServeHTTP(wrapResponseWriter(w, rec), r)
 }
 
 // LbHandler is the load balancer handler
 // it passes the request to the next available peer
 func (s *ServerPool) LbHandler(w http.ResponseWriter, r *http.Request) {
-	peer := s.NextPeer()
-	if peer != nil {
-		peer.Proxy.ServeHTTP(w, r)
+	peer := s.NextPeer(r)
+	if peer == nil {
+		http.Error(w, "Service not available", http.StatusServiceUnavailable)
 		return
 	}
-	http.Error(w, "Service not available", http.StatusServiceUnavailable)
+	s.serve(peer, w, r)
 }
 
-// ActiveHealthCheck finds the selected backend is unresponsive,
-// marks it as dead and returns true
-// LbHandlerWithHealthCheck is the active health check load balancer handler
-// it passes the request to the next available peer
+// LbHandlerWithHealthCheck is the active/passive health-check-aware load
+// balancer handler: it skips dead or ejected peers and gives up once
+// attempts exceeds the retry cap (the peer's Proxy.ErrorHandler, wired
+// by EnablePassiveHealthCheck, is what drives attempts up on failure).
 func (s *ServerPool) LbHandlerWithHealthCheck(w http.ResponseWriter, r *http.Request) {
 	attempts := GetAttemptsFromContext(r)
 	if attempts > 3 {
 		http.Error(w, "Service not available", http.StatusServiceUnavailable)
 		return
 	}
-	peer := s.NextPeer()
-	if peer != nil {
-		peer.Proxy.ServeHTTP(w, r)
+	peer := s.NextPeer(r)
+	if peer == nil {
+		http.Error(w, "Service not available", http.StatusServiceUnavailable)
 		return
 	}
-	http.Error(w, "Service not available", http.StatusServiceUnavailable)
+	s.serve(peer, w, r)
 }
 
 const (
@@ -116,34 +384,80 @@ func GetAttemptsFromContext(r *http.Request) int {
 	return 0
 }
 
-// PassiveHealthCheck checks the health of the backend
-// by doing a GET request to /healthz
+// StartHealthChecks launches one active health-check goroutine per
+// backend, driven by that backend's HealthCheck (or a default TCP check
+// on a 2 second interval when unset). Backends added afterward via
+// AddBackend/ReplaceBackends/a Provider are started the same way. Call
+// Stop to cancel them.
+func (s *ServerPool) StartHealthChecks() {
+	s.healthCtx, s.healthCancel = context.WithCancel(context.Background())
+	for _, b := range s.Backends() {
+		s.startBackendHealthCheck(b)
+	}
+}
 
-// isAliveCheck performs a check on a backend and updates its status
-func isAliveCheck(u *url.URL) bool {
-	timeout := 2 * time.Second
-	conn, err := net.DialTimeout("tcp", u.Host, timeout)
-	if err != nil {
-		log.Println("Site unreachable, error: ", err)
-		return false
+// startBackendHealthCheck launches b's active health-check goroutine,
+// derived from the context established by StartHealthChecks so Stop
+// still cancels it, and records its CancelFunc under b.ID() so a later
+// RemoveBackend or AddBackend replacement can stop it individually.
+func (s *ServerPool) startBackendHealthCheck(b *Backend) {
+	hc := b.HealthCheck
+	if hc == nil {
+		hc = &HealthChecker{}
+	}
+	hc.init()
+
+	ctx, cancel := context.WithCancel(s.healthCtx)
+	s.healthMu.Lock()
+	if s.healthCancels == nil {
+		s.healthCancels = make(map[string]context.CancelFunc)
 	}
-	_ = conn.Close()
-	return true
+	s.healthCancels[b.ID()] = cancel
+	s.healthMu.Unlock()
+
+	s.healthWG.Add(1)
+	go s.runHealthCheck(ctx, b, hc)
 }
 
-// HealthCheck runs a routine for checking the health of the backends
-func (s *ServerPool) HealthCheck() {
-	t := time.NewTicker(time.Second * 2)
-	for v := range t.C {
-		log.Println("Health checkup at ", v)
-		for _, b := range s.backends {
-			status := isAliveCheck(b.URL)
-			b.SetAlive(status)
-			if status {
-				log.Println(b.URL, "is alive")
-			} else {
-				log.Println(b.URL, "is dead")
-			}
+// stopBackendHealthCheck cancels the active health-check goroutine
+// registered for id, if any. It is a no-op if id has none (health checks
+// were never started, or id's backend never had one).
+func (s *ServerPool) stopBackendHealthCheck(id string) {
+	s.healthMu.Lock()
+	cancel, ok := s.healthCancels[id]
+	if ok {
+		delete(s.healthCancels, id)
+	}
+	s.healthMu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// runHealthCheck probes b on hc.Interval until ctx is cancelled.
+func (s *ServerPool) runHealthCheck(ctx context.Context, b *Backend, hc *HealthChecker) {
+	defer s.healthWG.Done()
+	t := time.NewTicker(hc.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			probeCtx, cancel := context.WithTimeout(ctx, hc.Timeout)
+			up := hc.Probe(probeCtx, b.URL)
+			cancel()
+			b.SetAlive(up)
+			reportBackendUp(b.URL, up)
 		}
 	}
 }
+
+// Stop cancels all health-check goroutines started by StartHealthChecks
+// and waits for them to exit.
+func (s *ServerPool) Stop() {
+	if s.healthCancel != nil {
+		s.healthCancel()
+	}
+	s.healthWG.Wait()
+}
@@ -0,0 +1,43 @@
+package goloadbalancer
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAddBackendStopsSupersededHealthCheck(t *testing.T) {
+	u, _ := url.Parse("http://backend1")
+	b := &Backend{URL: u, Alive: true, HealthCheck: &HealthChecker{Interval: time.Millisecond, Timeout: time.Millisecond}}
+	pool := NewServerPool([]*Backend{b}, nil)
+	pool.StartHealthChecks()
+	defer pool.Stop()
+
+	for i := 0; i < 20; i++ {
+		pool.AddBackend(b)
+	}
+
+	pool.healthMu.Lock()
+	count := len(pool.healthCancels)
+	pool.healthMu.Unlock()
+	if count != 1 {
+		t.Fatalf("expected exactly one tracked health-check goroutine after repeated AddBackend, got %d", count)
+	}
+}
+
+func TestRemoveBackendStopsHealthCheck(t *testing.T) {
+	u, _ := url.Parse("http://backend1")
+	b := &Backend{URL: u, Alive: true, HealthCheck: &HealthChecker{Interval: time.Millisecond, Timeout: time.Millisecond}}
+	pool := NewServerPool([]*Backend{b}, nil)
+	pool.StartHealthChecks()
+	defer pool.Stop()
+
+	pool.RemoveBackend(b.ID())
+
+	pool.healthMu.Lock()
+	_, ok := pool.healthCancels[b.ID()]
+	pool.healthMu.Unlock()
+	if ok {
+		t.Fatal("expected RemoveBackend to stop tracking the backend's health check")
+	}
+}
@@ -0,0 +1,202 @@
+package goloadbalancer
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PassiveHealthCheck configures the circuit breaker installed by
+// ServerPool.EnablePassiveHealthCheck. Unlike HealthChecker, it does not
+// send synthetic probes: it watches the status codes and errors of real
+// requests and ejects a backend once it looks unhealthy.
+type PassiveHealthCheck struct {
+	// MaxConsecutiveFailures ejects a backend once this many requests
+	// in a row fail (a 5xx response or a proxy/network error) within
+	// Window. Default 5.
+	MaxConsecutiveFailures int
+	// Window bounds how long a failure streak is considered
+	// consecutive; once more than Window has passed since the previous
+	// failure, the streak resets. Default 10s.
+	Window time.Duration
+	// BaseBackoff is how long a backend is ejected for the first time;
+	// each subsequent ejection doubles it, up to MaxBackoff. Default 1s.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the ejection backoff. Default 1 minute.
+	MaxBackoff time.Duration
+}
+
+func (cfg *PassiveHealthCheck) maxConsecutiveFailures() int {
+	if cfg.MaxConsecutiveFailures > 0 {
+		return cfg.MaxConsecutiveFailures
+	}
+	return 5
+}
+
+func (cfg *PassiveHealthCheck) window() time.Duration {
+	if cfg.Window > 0 {
+		return cfg.Window
+	}
+	return 10 * time.Second
+}
+
+func (cfg *PassiveHealthCheck) baseBackoff() time.Duration {
+	if cfg.BaseBackoff > 0 {
+		return cfg.BaseBackoff
+	}
+	return time.Second
+}
+
+func (cfg *PassiveHealthCheck) maxBackoff() time.Duration {
+	if cfg.MaxBackoff > 0 {
+		return cfg.MaxBackoff
+	}
+	return time.Minute
+}
+
+// EnablePassiveHealthCheck turns on circuit-breaker ejection for every
+// backend currently in the pool, and for any backend added afterward
+// (AddBackend, ReplaceBackends, a Provider): each backend's
+// Proxy.ErrorHandler is wired to record the failure and retry against
+// the pool (incrementing AttemptsKey) instead of returning an error
+// straight to the client. If cfg is nil, sensible defaults are used.
+func (s *ServerPool) EnablePassiveHealthCheck(cfg *PassiveHealthCheck) {
+	if cfg == nil {
+		cfg = &PassiveHealthCheck{}
+	}
+	s.passive = cfg
+	for _, b := range s.Backends() {
+		s.wireErrorHandler(b)
+	}
+}
+
+// wireErrorHandler installs the circuit-breaker-aware Proxy.ErrorHandler
+// on backend, recording the failure and retrying against the pool.
+func (s *ServerPool) wireErrorHandler(backend *Backend) {
+	backend.Proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Println(backend.URL, "proxy error:", err)
+		backend.RecordFailure(s.passive)
+		attempts := GetAttemptsFromContext(r)
+		ctx := context.WithValue(r.Context(), AttemptsKey, attempts+1)
+		s.LbHandlerWithHealthCheck(w, r.WithContext(ctx))
+	}
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status code
+// written by the backend's ReverseProxy, so serve() can feed it into the
+// circuit breaker and latency tracking.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// wrapResponseWriter wraps w in rec, returning a value that implements
+// exactly the optional interfaces (http.Flusher, http.Hijacker,
+// http.Pusher) that w itself implements. httputil.ReverseProxy
+// type-asserts its ResponseWriter for these to support WebSocket
+// upgrades (Hijacker) and low-latency streaming (Flusher), so a plain
+// embedding of http.ResponseWriter alone would silently break both for
+// every request proxied through serve().
+func wrapResponseWriter(w http.ResponseWriter, rec *statusRecorder) http.ResponseWriter {
+	flusher, hasFlusher := w.(http.Flusher)
+	hijacker, hasHijacker := w.(http.Hijacker)
+	pusher, hasPusher := w.(http.Pusher)
+
+	switch {
+	case hasFlusher && hasHijacker && hasPusher:
+		return &struct {
+			*statusRecorder
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rec, flusher, hijacker, pusher}
+	case hasFlusher && hasHijacker:
+		return &struct {
+			*statusRecorder
+			http.Flusher
+			http.Hijacker
+		}{rec, flusher, hijacker}
+	case hasFlusher && hasPusher:
+		return &struct {
+			*statusRecorder
+			http.Flusher
+			http.Pusher
+		}{rec, flusher, pusher}
+	case hasHijacker && hasPusher:
+		return &struct {
+			*statusRecorder
+			http.Hijacker
+			http.Pusher
+		}{rec, hijacker, pusher}
+	case hasFlusher:
+		return &struct {
+			*statusRecorder
+			http.Flusher
+		}{rec, flusher}
+	case hasHijacker:
+		return &struct {
+			*statusRecorder
+			http.Hijacker
+		}{rec, hijacker}
+	case hasPusher:
+		return &struct {
+			*statusRecorder
+			http.Pusher
+		}{rec, pusher}
+	default:
+		return rec
+	}
+}
+
+// RecordSuccess clears this backend's passive failure streak.
+func (b *Backend) RecordSuccess() {
+	b.pheMu.Lock()
+	b.consecutiveFails = 0
+	b.pheMu.Unlock()
+}
+
+// RecordFailure registers a passive failure (a 5xx response or a
+// proxy/network error) and, once cfg's threshold is crossed within
+// cfg.Window, ejects the backend for an exponentially growing backoff.
+func (b *Backend) RecordFailure(cfg *PassiveHealthCheck) {
+	b.pheMu.Lock()
+	defer b.pheMu.Unlock()
+
+	now := time.Now()
+	if b.lastFailure.IsZero() || now.Sub(b.lastFailure) > cfg.window() {
+		b.consecutiveFails = 0
+	}
+	b.lastFailure = now
+	b.consecutiveFails++
+	if b.consecutiveFails < cfg.maxConsecutiveFailures() {
+		return
+	}
+
+	backoff := cfg.baseBackoff() * time.Duration(1<<b.ejectionCount)
+	if backoff <= 0 || backoff > cfg.maxBackoff() {
+		backoff = cfg.maxBackoff()
+	}
+	b.ejectedUntil = now.Add(backoff)
+	b.ejectionCount++
+	b.consecutiveFails = 0
+	log.Println(b.URL, "ejected for", backoff, "after passive health check failures")
+}
+
+// IsEjected reports whether the circuit breaker currently has this
+// backend ejected from rotation. Once the ejection window elapses the
+// backend is admitted again with an empty failure streak: RecordFailure
+// ejects it again, with a longer backoff, only after another
+// MaxConsecutiveFailures failures within Window, so a single failed
+// request after re-admission does not eject it unless that threshold
+// is 1.
+func (b *Backend) IsEjected() bool {
+	b.pheMu.Lock()
+	defer b.pheMu.Unlock()
+	return time.Now().Before(b.ejectedUntil)
+}
@@ -0,0 +1,85 @@
+package goloadbalancer
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRecordFailureEjectsAfterThreshold(t *testing.T) {
+	u, _ := url.Parse("http://backend1")
+	b := &Backend{URL: u, Alive: true}
+	cfg := &PassiveHealthCheck{MaxConsecutiveFailures: 3, BaseBackoff: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		b.RecordFailure(cfg)
+	}
+	if b.IsEjected() {
+		t.Fatal("backend should not be ejected before reaching the failure threshold")
+	}
+
+	b.RecordFailure(cfg)
+	if !b.IsEjected() {
+		t.Fatal("backend should be ejected once consecutive failures reach the threshold")
+	}
+	if b.IsAlive() {
+		t.Fatal("IsAlive should report false while the backend is ejected")
+	}
+}
+
+func TestRecordFailureBackoffGrowsExponentially(t *testing.T) {
+	u, _ := url.Parse("http://backend1")
+	b := &Backend{URL: u, Alive: true}
+	cfg := &PassiveHealthCheck{MaxConsecutiveFailures: 1, BaseBackoff: time.Second, MaxBackoff: time.Hour}
+
+	b.RecordFailure(cfg)
+	first := time.Until(b.ejectedUntil)
+	if first <= 0 || first > 2*time.Second {
+		t.Fatalf("expected ~1s backoff on first ejection, got %v", first)
+	}
+	if b.ejectionCount != 1 {
+		t.Fatalf("expected ejectionCount 1, got %d", b.ejectionCount)
+	}
+
+	b.RecordFailure(cfg)
+	second := time.Until(b.ejectedUntil)
+	if second <= first {
+		t.Fatalf("expected second ejection's backoff (%v) to exceed the first (%v)", second, first)
+	}
+	if b.ejectionCount != 2 {
+		t.Fatalf("expected ejectionCount 2, got %d", b.ejectionCount)
+	}
+}
+
+func TestRecordFailureBackoffCapsAtMaxBackoff(t *testing.T) {
+	u, _ := url.Parse("http://backend1")
+	b := &Backend{URL: u, Alive: true}
+	cfg := &PassiveHealthCheck{MaxConsecutiveFailures: 1, BaseBackoff: time.Second, MaxBackoff: 3 * time.Second}
+
+	for i := 0; i < 5; i++ {
+		b.RecordFailure(cfg)
+	}
+	backoff := time.Until(b.ejectedUntil)
+	if backoff > cfg.MaxBackoff+time.Second {
+		t.Fatalf("expected backoff to be capped near %v, got %v", cfg.MaxBackoff, backoff)
+	}
+}
+
+func TestRecordSuccessResetsStreak(t *testing.T) {
+	u, _ := url.Parse("http://backend1")
+	b := &Backend{URL: u, Alive: true}
+	cfg := &PassiveHealthCheck{MaxConsecutiveFailures: 3, BaseBackoff: time.Minute}
+
+	b.RecordFailure(cfg)
+	b.RecordFailure(cfg)
+	b.RecordSuccess()
+	if b.consecutiveFails != 0 {
+		t.Fatalf("expected RecordSuccess to clear the failure streak, got %d", b.consecutiveFails)
+	}
+
+	b.RecordFailure(cfg)
+	b.RecordFailure(cfg)
+	if b.IsEjected() {
+		t.Fatal("two failures after a reset streak should not be enough to eject")
+	}
+}
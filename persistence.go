@@ -0,0 +1,269 @@
+package goloadbalancer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// PersistenceMode selects how a Persistence keeps a client pinned to the
+// same backend across requests.
+type PersistenceMode string
+
+const (
+	// PersistenceSourceIP hashes the client's address onto a consistent-
+	// hashing ring of alive backends, so the same client keeps landing
+	// on the same backend even as the pool changes.
+	PersistenceSourceIP PersistenceMode = "source-ip"
+	// PersistenceCookie reads and writes the StickyCookieName cookie to
+	// pin a client to the backend it first landed on.
+	PersistenceCookie PersistenceMode = "cookie"
+)
+
+// StickyCookieName is the cookie PersistenceCookie uses to remember
+// which backend a client was routed to.
+const StickyCookieName = "GLB_ID"
+
+// sourceIPVNodes is the number of virtual nodes each backend gets on the
+// source-IP affinity ring.
+const sourceIPVNodes = 160
+
+// Persistence configures session affinity for a ServerPool. Install it
+// with ServerPool.EnablePersistence; NextPeer consults it before the
+// pool's Strategy.
+type Persistence struct {
+	// Mode selects source-IP or cookie-based affinity.
+	Mode PersistenceMode
+	// TrustForwardedFor honors the left-most X-Forwarded-For entry
+	// instead of r.RemoteAddr when hashing by source IP. Only enable
+	// this behind a trusted proxy that strips client-supplied XFF
+	// headers.
+	TrustForwardedFor bool
+	// CookieSecret signs the sticky cookie's value (HMAC-SHA256) so a
+	// client can't forge a route to an arbitrary backend. Required for
+	// PersistenceCookie.
+	CookieSecret []byte
+
+	// ring caches the PersistenceSourceIP consistent-hashing ring so
+	// pickBySourceIP doesn't rebuild and sort a vnodes-sized ring on
+	// every request; see sourceIPRing.
+	ring atomic.Pointer[hashRing]
+	// sigMu protects sig.
+	sigMu sync.Mutex
+	// sig is the alive-backend signature the cached ring was built from.
+	sig string
+}
+
+// EnablePersistence turns on session affinity for the pool. In
+// PersistenceCookie mode, every current backend's Proxy.ModifyResponse is
+// wrapped to stamp the sticky cookie onto responses it serves, and so is
+// any backend added afterward (AddBackend, ReplaceBackends, a Provider).
+func (s *ServerPool) EnablePersistence(p *Persistence) {
+	s.persistence = p
+	if p == nil || p.Mode != PersistenceCookie {
+		return
+	}
+	for _, b := range s.Backends() {
+		s.wireStickyCookie(b)
+	}
+}
+
+// wireStickyCookie wraps backend's Proxy.ModifyResponse to stamp the
+// sticky cookie, signed for backend's ID, onto every response it serves.
+func (s *ServerPool) wireStickyCookie(backend *Backend) {
+	p := s.persistence
+	next := backend.Proxy.ModifyResponse
+	backend.Proxy.ModifyResponse = func(resp *http.Response) error {
+		if next != nil {
+			if err := next(resp); err != nil {
+				return err
+			}
+		}
+		cookie := &http.Cookie{
+			Name:     StickyCookieName,
+			Value:    p.signCookie(backend.ID()),
+			Path:     "/",
+			HttpOnly: true,
+		}
+		resp.Header.Add("Set-Cookie", cookie.String())
+		return nil
+	}
+}
+
+// pick selects a backend for r using p's mode, or returns nil so the
+// caller falls back to its Strategy (persistence doesn't apply, e.g. the
+// sticky cookie is missing or points at a dead backend).
+func (p *Persistence) pick(pool *ServerPool, r *http.Request) *Backend {
+	switch p.Mode {
+	case PersistenceSourceIP:
+		return p.pickBySourceIP(pool, r)
+	case PersistenceCookie:
+		return p.pickByCookie(pool, r)
+	default:
+		return nil
+	}
+}
+
+func (p *Persistence) pickBySourceIP(pool *ServerPool, r *http.Request) *Backend {
+	key := p.clientKey(r)
+	if key == "" {
+		return nil
+	}
+	return p.sourceIPRing(pool).get(key)
+}
+
+// sourceIPRing returns the ring for pool's currently alive backends,
+// reusing the cached one unless the alive set has changed since it was
+// built. This mirrors ConsistentHash's caching (see consistenthash.go):
+// without it, every single request under PersistenceSourceIP would
+// allocate and sort a len(backends)*vnodes-entry ring from scratch.
+func (p *Persistence) sourceIPRing(pool *ServerPool) *hashRing {
+	backends := pool.Backends()
+	sig := aliveBackendSignature(backends)
+
+	p.sigMu.Lock()
+	changed := sig != p.sig
+	p.sigMu.Unlock()
+	if !changed {
+		if ring := p.ring.Load(); ring != nil {
+			return ring
+		}
+	}
+
+	ring := newHashRing(backends, sourceIPVNodes)
+	p.sigMu.Lock()
+	p.sig = sig
+	p.sigMu.Unlock()
+	p.ring.Store(ring)
+	return ring
+}
+
+// clientKey extracts the address used to hash r's client onto the ring.
+func (p *Persistence) clientKey(r *http.Request) string {
+	if p.TrustForwardedFor {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (p *Persistence) pickByCookie(pool *ServerPool, r *http.Request) *Backend {
+	c, err := r.Cookie(StickyCookieName)
+	if err != nil {
+		return nil
+	}
+	id, ok := p.verifyCookie(c.Value)
+	if !ok {
+		return nil
+	}
+	for _, b := range pool.Backends() {
+		if b.ID() == id && b.IsAlive() {
+			return b
+		}
+	}
+	return nil
+}
+
+// signCookie returns id with an HMAC-SHA256 signature appended.
+func (p *Persistence) signCookie(id string) string {
+	mac := hmac.New(sha256.New, p.CookieSecret)
+	_, _ = mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCookie checks value's signature and, if valid, returns the
+// backend ID it carries.
+func (p *Persistence) verifyCookie(value string) (string, bool) {
+	idx := strings.LastIndex(value, ".")
+	if idx < 0 {
+		return "", false
+	}
+	id, sig := value[:idx], value[idx+1:]
+	mac := hmac.New(sha256.New, p.CookieSecret)
+	_, _ = mac.Write([]byte(id))
+	want := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return "", false
+	}
+	return id, true
+}
+
+// aliveBackendSignature identifies the current set of alive backends,
+// cheaply enough to call on every request: both PersistenceSourceIP and
+// ConsistentHash use it to tell whether their cached ring needs
+// rebuilding.
+func aliveBackendSignature(backends []*Backend) string {
+	var sig strings.Builder
+	for _, b := range backends {
+		if b.IsAlive() {
+			sig.WriteString(b.ID())
+			sig.WriteByte(';')
+		}
+	}
+	return sig.String()
+}
+
+// hashRing is a minimal consistent-hashing ring mapping hash positions
+// to backends. It backs both PersistenceSourceIP and the ConsistentHash
+// strategy (see consistenthash.go), which wraps it with a pluggable
+// request-key extractor.
+type hashRing struct {
+	positions []uint32
+	backends  map[uint32]*Backend
+}
+
+// newHashRing builds a ring with vnodes virtual nodes per alive backend.
+func newHashRing(backends []*Backend, vnodes int) *hashRing {
+	r := &hashRing{backends: make(map[uint32]*Backend)}
+	for _, b := range backends {
+		if !b.IsAlive() {
+			continue
+		}
+		for i := 0; i < vnodes; i++ {
+			h := ringHash(b.ID(), i)
+			r.positions = append(r.positions, h)
+			r.backends[h] = b
+		}
+	}
+	sort.Slice(r.positions, func(i, j int) bool { return r.positions[i] < r.positions[j] })
+	return r
+}
+
+// get returns the backend owning the first ring position at or after
+// key's hash, wrapping around to the first position.
+func (r *hashRing) get(key string) *Backend {
+	if len(r.positions) == 0 {
+		return nil
+	}
+	h := ringHash(key, -1)
+	i := sort.Search(len(r.positions), func(i int) bool { return r.positions[i] >= h })
+	if i == len(r.positions) {
+		i = 0
+	}
+	return r.backends[r.positions[i]]
+}
+
+// ringHash hashes s, optionally salted with a virtual-node index (pass
+// -1 for an unsalted key hash), using FNV-1a (stdlib hash/fnv) as a
+// dependency-free stand-in for a dedicated non-cryptographic hash like
+// xxhash; goloadbalancer has no go.mod to pull one in.
+func ringHash(s string, vnode int) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	if vnode >= 0 {
+		_, _ = h.Write([]byte{byte(vnode), byte(vnode >> 8)})
+	}
+	return h.Sum32()
+}
@@ -0,0 +1,121 @@
+package goloadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+)
+
+func TestPersistencePickByCookieValid(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: true, Proxy: httputil.NewSingleHostReverseProxy(u1)}
+	b2 := &Backend{URL: u2, Alive: true, Proxy: httputil.NewSingleHostReverseProxy(u2)}
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+
+	p := &Persistence{Mode: PersistenceCookie, CookieSecret: []byte("s3cr3t")}
+	pool.EnablePersistence(p)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: StickyCookieName, Value: p.signCookie(b2.ID())})
+
+	peer := pool.NextPeer(req)
+	if peer == nil || peer.ID() != b2.ID() {
+		t.Fatalf("expected the cookie to pin the request to backend2, got %v", peer)
+	}
+}
+
+func TestPersistencePickByCookieTampered(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	b1 := &Backend{URL: u1, Alive: true, Proxy: httputil.NewSingleHostReverseProxy(u1)}
+	pool := NewServerPool([]*Backend{b1}, nil)
+
+	p := &Persistence{Mode: PersistenceCookie, CookieSecret: []byte("s3cr3t")}
+	pool.EnablePersistence(p)
+
+	valid := p.signCookie(b1.ID())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: StickyCookieName, Value: valid + "tampered"})
+
+	if _, ok := p.verifyCookie(valid + "tampered"); ok {
+		t.Fatal("expected a tampered cookie signature to fail verification")
+	}
+	// Falls back to the pool's Strategy (round robin) rather than trusting
+	// the forged cookie.
+	if peer := pool.NextPeer(req); peer == nil {
+		t.Fatal("expected the strategy fallback to still pick a backend")
+	}
+}
+
+func TestPersistencePickByCookieMissing(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	b1 := &Backend{URL: u1, Alive: true, Proxy: httputil.NewSingleHostReverseProxy(u1)}
+	pool := NewServerPool([]*Backend{b1}, nil)
+
+	p := &Persistence{Mode: PersistenceCookie, CookieSecret: []byte("s3cr3t")}
+	pool.EnablePersistence(p)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if peer := pool.NextPeer(req); peer == nil {
+		t.Fatal("expected a missing cookie to fall back to the strategy, not return nil")
+	}
+}
+
+func TestPersistenceVerifyCookieRoundTrip(t *testing.T) {
+	p := &Persistence{CookieSecret: []byte("s3cr3t")}
+	signed := p.signCookie("http://backend1")
+
+	id, ok := p.verifyCookie(signed)
+	if !ok || id != "http://backend1" {
+		t.Fatalf("expected verifyCookie to recover the signed ID, got %q, %v", id, ok)
+	}
+
+	if _, ok := p.verifyCookie("http://backend1.bad-signature"); ok {
+		t.Fatal("expected a bad signature to fail verification")
+	}
+	if _, ok := p.verifyCookie("no-dot-separator"); ok {
+		t.Fatal("expected a value with no signature separator to fail verification")
+	}
+}
+
+func TestPersistencePickBySourceIP(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: true}
+	b2 := &Backend{URL: u2, Alive: true}
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+	pool.EnablePersistence(&Persistence{Mode: PersistenceSourceIP})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:54321"
+
+	first := pool.NextPeer(req)
+	for i := 0; i < 10; i++ {
+		if got := pool.NextPeer(req); got.ID() != first.ID() {
+			t.Fatalf("expected the same source IP to keep landing on the same backend, got %v want %v", got.ID(), first.ID())
+		}
+	}
+}
+
+func TestPersistenceSourceIPRingIsCachedUntilAliveSetChanges(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: true}
+	b2 := &Backend{URL: u2, Alive: true}
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+	p := &Persistence{Mode: PersistenceSourceIP}
+
+	ring1 := p.sourceIPRing(pool)
+	ring2 := p.sourceIPRing(pool)
+	if ring1 != ring2 {
+		t.Fatal("expected the ring to be reused when the alive set hasn't changed")
+	}
+
+	b1.SetAlive(false)
+	ring3 := p.sourceIPRing(pool)
+	if ring3 == ring1 {
+		t.Fatal("expected the ring to be rebuilt once the alive set changes")
+	}
+}
@@ -0,0 +1,321 @@
+package goloadbalancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// BackendEventType classifies a change a Provider observed in its
+// upstream source.
+type BackendEventType int
+
+const (
+	// BackendAdded announces a new backend, or replaces an existing one
+	// with the same ID.
+	BackendAdded BackendEventType = iota
+	// BackendRemoved announces that a backend should leave the pool.
+	BackendRemoved
+	// BackendUpdated is an alias for BackendAdded: ServerPool upserts by
+	// ID either way, so providers may use whichever reads better.
+	BackendUpdated = BackendAdded
+)
+
+// BackendEvent is emitted by a Provider as the backends it discovers
+// change.
+type BackendEvent struct {
+	Type    BackendEventType
+	Backend *Backend
+}
+
+// Provider discovers backends from an external source and emits
+// BackendEvent values on events as that source changes. Run blocks
+// until ctx is cancelled and then returns ctx.Err().
+type Provider interface {
+	Run(ctx context.Context, events chan<- BackendEvent) error
+}
+
+// Watch runs provider in the background, applying every BackendEvent it
+// emits to the pool (BackendAdded/BackendUpdated upsert by backend ID,
+// BackendRemoved takes a backend out of rotation), until ctx is
+// cancelled or provider.Run returns.
+func (s *ServerPool) Watch(ctx context.Context, provider Provider) error {
+	events := make(chan BackendEvent)
+	done := make(chan error, 1)
+	go func() { done <- provider.Run(ctx, events) }()
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == BackendRemoved {
+				s.RemoveBackend(ev.Backend.ID())
+			} else {
+				s.AddBackend(ev.Backend)
+			}
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// FileBackendSpec is one entry in a FileProvider's config file.
+type FileBackendSpec struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// FileProvider discovers backends from a JSON file containing a list of
+// FileBackendSpec, reloading whenever the file's contents change. It
+// polls the file's mtime rather than using a filesystem watcher, so it
+// has no dependency beyond the standard library.
+type FileProvider struct {
+	// Path is the config file to watch.
+	Path string
+	// PollInterval is how often the file is checked for changes
+	// (default 2s).
+	PollInterval time.Duration
+	// NewProxy builds the ReverseProxy for a discovered backend URL.
+	NewProxy func(u *url.URL) *httputil.ReverseProxy
+
+	modTime time.Time
+	known   map[string]FileBackendSpec
+}
+
+// Run implements Provider.
+func (p *FileProvider) Run(ctx context.Context, events chan<- BackendEvent) error {
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	p.known = map[string]FileBackendSpec{}
+	if err := p.reloadIfChanged(events); err != nil {
+		log.Println("file provider:", err)
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := p.reloadIfChanged(events); err != nil {
+				log.Println("file provider:", err)
+			}
+		}
+	}
+}
+
+func (p *FileProvider) reloadIfChanged(events chan<- BackendEvent) error {
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return err
+	}
+	if !info.ModTime().After(p.modTime) {
+		return nil
+	}
+	p.modTime = info.ModTime()
+
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return err
+	}
+	var specs []FileBackendSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return err
+	}
+
+	seen := make(map[string]FileBackendSpec, len(specs))
+	for _, spec := range specs {
+		u, err := url.Parse(spec.URL)
+		if err != nil {
+			log.Println("file provider: skipping invalid URL", spec.URL, ":", err)
+			continue
+		}
+		id := u.String()
+		seen[id] = spec
+		// Only emit an event when the spec is new or actually changed:
+		// AddBackend replaces the existing *Backend wholesale by ID, which
+		// would otherwise reset Alive, connection/latency stats and the
+		// passive health check circuit-breaker state on every poll tick.
+		if prev, ok := p.known[id]; ok && prev == spec {
+			continue
+		}
+		events <- BackendEvent{Type: BackendAdded, Backend: &Backend{URL: u, Alive: true, Weight: spec.Weight, Proxy: p.NewProxy(u)}}
+	}
+	for id, spec := range p.known {
+		if _, ok := seen[id]; !ok {
+			u, _ := url.Parse(spec.URL)
+			events <- BackendEvent{Type: BackendRemoved, Backend: &Backend{URL: u}}
+		}
+	}
+	p.known = seen
+	return nil
+}
+
+// DNSProvider discovers backends via DNS SRV lookups, polled on an
+// interval.
+type DNSProvider struct {
+	// Service, Proto and Name are passed to net.Resolver.LookupSRV, e.g.
+	// ("http", "tcp", "backend.service.consul").
+	Service, Proto, Name string
+	// Scheme is used to build each discovered backend's URL (default
+	// "http").
+	Scheme string
+	// PollInterval is how often DNS is re-queried (default 10s).
+	PollInterval time.Duration
+	// NewProxy builds the ReverseProxy for a discovered backend URL.
+	NewProxy func(u *url.URL) *httputil.ReverseProxy
+
+	known map[string]*url.URL
+}
+
+// Run implements Provider.
+func (p *DNSProvider) Run(ctx context.Context, events chan<- BackendEvent) error {
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	p.known = map[string]*url.URL{}
+	if err := p.reload(ctx, events); err != nil {
+		log.Println("dns provider:", err)
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := p.reload(ctx, events); err != nil {
+				log.Println("dns provider:", err)
+			}
+		}
+	}
+}
+
+func (p *DNSProvider) reload(ctx context.Context, events chan<- BackendEvent) error {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, p.Service, p.Proto, p.Name)
+	if err != nil {
+		return err
+	}
+	scheme := p.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	seen := make(map[string]*url.URL, len(records))
+	for _, rec := range records {
+		host := strings.TrimSuffix(rec.Target, ".")
+		u := &url.URL{Scheme: scheme, Host: net.JoinHostPort(host, fmt.Sprint(rec.Port))}
+		seen[u.String()] = u
+		if _, ok := p.known[u.String()]; !ok {
+			events <- BackendEvent{Type: BackendAdded, Backend: &Backend{URL: u, Alive: true, Proxy: p.NewProxy(u)}}
+		}
+	}
+	for id, u := range p.known {
+		if _, ok := seen[id]; !ok {
+			events <- BackendEvent{Type: BackendRemoved, Backend: &Backend{URL: u}}
+		}
+	}
+	p.known = seen
+	return nil
+}
+
+// KVPair is a single key/value entry returned by a KVStore.
+type KVPair struct {
+	Key   string
+	Value []byte
+}
+
+// KVStore lists the backends registered under a key prefix. Implement
+// this against a Consul (github.com/hashicorp/consul/api) or etcd
+// (go.etcd.io/etcd/client/v3) client to drive KVProvider; goloadbalancer
+// itself takes no dependency on either.
+type KVStore interface {
+	List(ctx context.Context, prefix string) ([]KVPair, error)
+}
+
+// KVProvider discovers backends from a KVStore key prefix, polled on an
+// interval, where each value is expected to be a backend URL.
+type KVProvider struct {
+	Store        KVStore
+	Prefix       string
+	PollInterval time.Duration
+	// NewProxy builds the ReverseProxy for a discovered backend URL.
+	NewProxy func(u *url.URL) *httputil.ReverseProxy
+
+	known map[string]kvEntry
+}
+
+// kvEntry remembers the raw value last seen for a KV key, so KVProvider
+// can tell an unchanged backend from one that actually moved.
+type kvEntry struct {
+	value []byte
+	url   *url.URL
+}
+
+// Run implements Provider.
+func (p *KVProvider) Run(ctx context.Context, events chan<- BackendEvent) error {
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	p.known = map[string]kvEntry{}
+	if err := p.reload(ctx, events); err != nil {
+		log.Println("kv provider:", err)
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := p.reload(ctx, events); err != nil {
+				log.Println("kv provider:", err)
+			}
+		}
+	}
+}
+
+func (p *KVProvider) reload(ctx context.Context, events chan<- BackendEvent) error {
+	pairs, err := p.Store.List(ctx, p.Prefix)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]kvEntry, len(pairs))
+	for _, pair := range pairs {
+		// Only emit an event when the key is new or its value actually
+		// changed: AddBackend replaces the existing *Backend wholesale by
+		// ID, which would otherwise reset Alive, connection/latency stats
+		// and the passive health check circuit-breaker state on every
+		// poll tick (the default 5s interval would defeat passive health
+		// checking entirely).
+		if prev, ok := p.known[pair.Key]; ok && bytes.Equal(prev.value, pair.Value) {
+			seen[pair.Key] = prev
+			continue
+		}
+		u, err := url.Parse(string(pair.Value))
+		if err != nil {
+			log.Println("kv provider: skipping invalid URL for key", pair.Key, ":", err)
+			continue
+		}
+		seen[pair.Key] = kvEntry{value: pair.Value, url: u}
+		events <- BackendEvent{Type: BackendAdded, Backend: &Backend{URL: u, Alive: true, Proxy: p.NewProxy(u)}}
+	}
+	for key, entry := range p.known {
+		if _, ok := seen[key]; !ok {
+			events <- BackendEvent{Type: BackendRemoved, Backend: &Backend{URL: entry.url}}
+		}
+	}
+	p.known = seen
+	return nil
+}
@@ -0,0 +1,102 @@
+package goloadbalancer
+
+import (
+	"encoding/json"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFileBackendSpecs(t *testing.T, path string, specs []FileBackendSpec, mtime time.Time) {
+	t.Helper()
+	data, err := json.Marshal(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestReverseProxy(u *url.URL) *httputil.ReverseProxy {
+	return httputil.NewSingleHostReverseProxy(u)
+}
+
+func TestFileProviderReloadIfChangedDiffing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backends.json")
+	now := time.Now()
+
+	writeFileBackendSpecs(t, path, []FileBackendSpec{
+		{URL: "http://backend1", Weight: 1},
+		{URL: "http://backend2", Weight: 1},
+	}, now)
+
+	p := &FileProvider{Path: path, NewProxy: newTestReverseProxy, known: map[string]FileBackendSpec{}}
+	events := make(chan BackendEvent, 10)
+
+	if err := p.reloadIfChanged(events); err != nil {
+		t.Fatal(err)
+	}
+	added := drainEvents(events)
+	if len(added) != 2 {
+		t.Fatalf("expected 2 BackendAdded events on first load, got %d", len(added))
+	}
+
+	// Re-running against an unchanged file must not re-emit anything: the
+	// mtime hasn't moved, so reloadIfChanged should short-circuit.
+	if err := p.reloadIfChanged(events); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainEvents(events); len(got) != 0 {
+		t.Fatalf("expected no events when the file is unchanged, got %d", len(got))
+	}
+
+	// Change backend2's weight, remove backend1 and add backend3: backend2
+	// should emit exactly one BackendAdded (changed spec), backend3 exactly
+	// one BackendAdded (new spec), and backend1 exactly one BackendRemoved.
+	writeFileBackendSpecs(t, path, []FileBackendSpec{
+		{URL: "http://backend2", Weight: 5},
+		{URL: "http://backend3", Weight: 1},
+	}, now.Add(time.Second))
+
+	if err := p.reloadIfChanged(events); err != nil {
+		t.Fatal(err)
+	}
+	changed := drainEvents(events)
+	if len(changed) != 3 {
+		t.Fatalf("expected 3 events (backend2 updated, backend3 added, backend1 removed), got %d: %+v", len(changed), changed)
+	}
+
+	var sawBackend1Removed, sawBackend2Added, sawBackend3Added bool
+	for _, ev := range changed {
+		switch {
+		case ev.Backend.ID() == "http://backend1" && ev.Type == BackendRemoved:
+			sawBackend1Removed = true
+		case ev.Backend.ID() == "http://backend2" && ev.Type == BackendAdded:
+			sawBackend2Added = true
+		case ev.Backend.ID() == "http://backend3" && ev.Type == BackendAdded:
+			sawBackend3Added = true
+		}
+	}
+	if !sawBackend1Removed || !sawBackend2Added || !sawBackend3Added {
+		t.Fatalf("missing expected diff events: %+v", changed)
+	}
+}
+
+func drainEvents(events chan BackendEvent) []BackendEvent {
+	var got []BackendEvent
+	for {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		default:
+			return got
+		}
+	}
+}
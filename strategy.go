@@ -0,0 +1,189 @@
+package goloadbalancer
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy picks the next backend to serve req. Implementations are
+// consulted by ServerPool.NextPeer on every request and must be safe for
+// concurrent use.
+type Strategy interface {
+	Pick(req *http.Request) *Backend
+}
+
+// RoundRobin is the classic round-robin Strategy: it cycles through the
+// pool's backends in order, skipping any that are not alive.
+type RoundRobin struct {
+	pool *ServerPool
+}
+
+// NewRoundRobin creates a RoundRobin strategy over pool's backends.
+func NewRoundRobin(pool *ServerPool) *RoundRobin {
+	return &RoundRobin{pool: pool}
+}
+
+// Pick implements Strategy.
+func (s *RoundRobin) Pick(r *http.Request) *Backend {
+	backends := s.pool.Backends()
+	if len(backends) == 0 {
+		return nil
+	}
+	next := s.pool.NextIndex(len(backends))
+	l := len(backends) + next // start from next and move a full cycle
+	for i := next; i < l; i++ {
+		index := i % len(backends)
+		if backends[index].IsAlive() {
+			// if we have an alive backend, use it and store it's index
+			if i != next {
+				atomic.StoreUint64(&s.pool.current, uint64(index))
+			}
+			return backends[index]
+		}
+	}
+	return nil
+}
+
+// WeightedRoundRobin is a Strategy implementing Nginx's smooth weighted
+// round-robin algorithm: on every pick, every alive backend's
+// currentWeight is bumped by its effectiveWeight, the backend with the
+// highest currentWeight wins, and the total weight is subtracted back
+// from the winner. This spreads picks proportionally to Backend.Weight
+// while keeping consecutive picks from piling onto a single backend.
+type WeightedRoundRobin struct {
+	pool *ServerPool
+	mu   sync.Mutex
+}
+
+// NewWeightedRoundRobin creates a WeightedRoundRobin strategy over pool's
+// backends, seeding each backend's effective weight from Backend.Weight
+// (defaulting to 1 when unset).
+func NewWeightedRoundRobin(pool *ServerPool) *WeightedRoundRobin {
+	for _, b := range pool.Backends() {
+		w := b.Weight
+		if w <= 0 {
+			w = 1
+		}
+		atomic.StoreInt64(&b.effectiveWeight, int64(w))
+	}
+	return &WeightedRoundRobin{pool: pool}
+}
+
+// Pick implements Strategy.
+func (s *WeightedRoundRobin) Pick(r *http.Request) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *Backend
+	var bestWeight int64
+	var totalWeight int64
+	for _, b := range s.pool.Backends() {
+		if !b.IsAlive() {
+			continue
+		}
+		ew := atomic.LoadInt64(&b.effectiveWeight)
+		if ew == 0 {
+			// Backends added after NewWeightedRoundRobin ran (AddBackend,
+			// ReplaceBackends, a Provider) never got their effectiveWeight
+			// seeded; seed it lazily from Backend.Weight so they aren't
+			// starved of traffic forever.
+			ew = int64(b.Weight)
+			if ew <= 0 {
+				ew = 1
+			}
+			atomic.StoreInt64(&b.effectiveWeight, ew)
+		}
+		totalWeight += ew
+		cw := atomic.AddInt64(&b.currentWeight, ew)
+		if best == nil || cw > bestWeight {
+			best = b
+			bestWeight = cw
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	atomic.AddInt64(&best.currentWeight, -totalWeight)
+	return best
+}
+
+// LeastConnections is a Strategy that sends each request to the alive
+// backend with the fewest in-flight requests (Backend.Connections).
+type LeastConnections struct {
+	pool *ServerPool
+}
+
+// NewLeastConnections creates a LeastConnections strategy over pool's
+// backends.
+func NewLeastConnections(pool *ServerPool) *LeastConnections {
+	return &LeastConnections{pool: pool}
+}
+
+// Pick implements Strategy.
+func (s *LeastConnections) Pick(r *http.Request) *Backend {
+	var best *Backend
+	var bestConns int64 = -1
+	for _, b := range s.pool.Backends() {
+		if !b.IsAlive() {
+			continue
+		}
+		conns := b.Connections()
+		if bestConns == -1 || conns < bestConns {
+			best = b
+			bestConns = conns
+		}
+	}
+	return best
+}
+
+// PowerOfTwoChoices is a Strategy that samples two random alive backends
+// and picks the one with the lower latency EWMA (Backend.EWMA). This
+// gives most of the benefit of LeastConnections-style load awareness
+// without scanning every backend on each pick.
+type PowerOfTwoChoices struct {
+	pool *ServerPool
+	mu   sync.Mutex
+	rnd  *rand.Rand
+}
+
+// NewPowerOfTwoChoices creates a PowerOfTwoChoices strategy over pool's
+// backends.
+func NewPowerOfTwoChoices(pool *ServerPool) *PowerOfTwoChoices {
+	return &PowerOfTwoChoices{
+		pool: pool,
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Pick implements Strategy.
+func (s *PowerOfTwoChoices) Pick(r *http.Request) *Backend {
+	alive := make([]*Backend, 0, len(s.pool.Backends()))
+	for _, b := range s.pool.Backends() {
+		if b.IsAlive() {
+			alive = append(alive, b)
+		}
+	}
+	switch len(alive) {
+	case 0:
+		return nil
+	case 1:
+		return alive[0]
+	}
+
+	s.mu.Lock()
+	i := s.rnd.Intn(len(alive))
+	j := s.rnd.Intn(len(alive) - 1)
+	s.mu.Unlock()
+	if j >= i {
+		j++
+	}
+
+	a, b := alive[i], alive[j]
+	if a.EWMA() <= b.EWMA() {
+		return a
+	}
+	return b
+}
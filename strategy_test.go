@@ -0,0 +1,173 @@
+package goloadbalancer
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWeightedRoundRobinDistributesByWeight(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: true, Weight: 1}
+	b2 := &Backend{URL: u2, Alive: true, Weight: 2}
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+	pool.SetStrategy(NewWeightedRoundRobin(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	counts := map[string]int{}
+	const n = 300
+	for i := 0; i < n; i++ {
+		peer := pool.NextPeer(req)
+		if peer == nil {
+			t.Fatal("expected a backend, got nil")
+		}
+		counts[peer.ID()]++
+	}
+
+	if counts[b1.ID()] == 0 || counts[b2.ID()] == 0 {
+		t.Fatalf("expected both backends to receive traffic, got %v", counts)
+	}
+	ratio := float64(counts[b2.ID()]) / float64(counts[b1.ID()])
+	if ratio < 1.5 || ratio > 2.5 {
+		t.Fatalf("expected backend2 to get ~2x backend1's traffic, got ratio %.2f (%v)", ratio, counts)
+	}
+}
+
+func TestWeightedRoundRobinSeedsBackendsAddedLater(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	b1 := &Backend{URL: u1, Alive: true, Weight: 1}
+	pool := NewServerPool([]*Backend{b1}, nil)
+	pool.SetStrategy(NewWeightedRoundRobin(pool))
+
+	u2, _ := url.Parse("http://backend2")
+	b2 := &Backend{URL: u2, Alive: true, Weight: 1}
+	pool.AddBackend(b2)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	counts := map[string]int{}
+	for i := 0; i < 50; i++ {
+		if peer := pool.NextPeer(req); peer != nil {
+			counts[peer.ID()]++
+		}
+	}
+	if counts[b2.ID()] == 0 {
+		t.Fatalf("backend added after construction never received traffic: %v", counts)
+	}
+}
+
+func TestRoundRobinCyclesAndSkipsDeadBackends(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	u3, _ := url.Parse("http://backend3")
+	b1 := &Backend{URL: u1, Alive: true}
+	b2 := &Backend{URL: u2, Alive: false}
+	b3 := &Backend{URL: u3, Alive: true}
+	pool := NewServerPool([]*Backend{b1, b2, b3}, nil)
+	pool.SetStrategy(NewRoundRobin(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	seen := map[string]int{}
+	for i := 0; i < 10; i++ {
+		peer := pool.NextPeer(req)
+		if peer == nil {
+			t.Fatal("expected a backend, got nil")
+		}
+		if peer.ID() == b2.ID() {
+			t.Fatal("round robin picked a dead backend")
+		}
+		seen[peer.ID()]++
+	}
+	if seen[b1.ID()] == 0 || seen[b3.ID()] == 0 {
+		t.Fatalf("expected round robin to cycle through both alive backends, got %v", seen)
+	}
+}
+
+func TestRoundRobinReturnsNilWhenAllDead(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	b1 := &Backend{URL: u1, Alive: false}
+	pool := NewServerPool([]*Backend{b1}, nil)
+	pool.SetStrategy(NewRoundRobin(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if peer := pool.NextPeer(req); peer != nil {
+		t.Fatalf("expected nil when every backend is dead, got %v", peer.ID())
+	}
+}
+
+func TestLeastConnectionsPicksFewestConnections(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	u3, _ := url.Parse("http://backend3")
+	b1 := &Backend{URL: u1, Alive: true}
+	b2 := &Backend{URL: u2, Alive: true}
+	b3 := &Backend{URL: u3, Alive: true}
+	b1.IncConnections()
+	b1.IncConnections()
+	b3.IncConnections()
+	pool := NewServerPool([]*Backend{b1, b2, b3}, nil)
+	pool.SetStrategy(NewLeastConnections(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	peer := pool.NextPeer(req)
+	if peer == nil || peer.ID() != b2.ID() {
+		t.Fatalf("expected the backend with the fewest connections (backend2), got %v", peer)
+	}
+}
+
+func TestLeastConnectionsSkipsDeadBackends(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: false}
+	b2 := &Backend{URL: u2, Alive: true}
+	b2.IncConnections()
+	b2.IncConnections()
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+	pool.SetStrategy(NewLeastConnections(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	peer := pool.NextPeer(req)
+	if peer == nil || peer.ID() != b2.ID() {
+		t.Fatalf("expected the only alive backend (backend2), got %v", peer)
+	}
+}
+
+func TestPowerOfTwoChoicesPrefersLowerEWMA(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	fast := &Backend{URL: u1, Alive: true}
+	slow := &Backend{URL: u2, Alive: true}
+	fast.RecordLatency(10 * time.Millisecond)
+	slow.RecordLatency(500 * time.Millisecond)
+	pool := NewServerPool([]*Backend{fast, slow}, nil)
+	pool.SetStrategy(NewPowerOfTwoChoices(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 30; i++ {
+		peer := pool.NextPeer(req)
+		if peer == nil {
+			t.Fatal("expected a backend, got nil")
+		}
+		// With exactly two alive backends both are always sampled, so the
+		// lower-EWMA one must win every time.
+		if peer != fast {
+			t.Fatalf("expected the lower-EWMA backend (EWMA %v), got one with EWMA %v", fast.EWMA(), peer.EWMA())
+		}
+	}
+}
+
+func TestPowerOfTwoChoicesSingleAliveBackend(t *testing.T) {
+	u1, _ := url.Parse("http://backend1")
+	u2, _ := url.Parse("http://backend2")
+	b1 := &Backend{URL: u1, Alive: false}
+	b2 := &Backend{URL: u2, Alive: true}
+	pool := NewServerPool([]*Backend{b1, b2}, nil)
+	pool.SetStrategy(NewPowerOfTwoChoices(pool))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	peer := pool.NextPeer(req)
+	if peer == nil || peer.ID() != b2.ID() {
+		t.Fatalf("expected the only alive backend (backend2), got %v", peer)
+	}
+}